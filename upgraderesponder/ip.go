@@ -0,0 +1,128 @@
+package upgraderesponder
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// trustedProxySet is the set of CIDRs a proxy chain entry must fall inside
+// to be treated as a hop rather than the requester's own address.
+type trustedProxySet struct {
+	nets []*net.IPNet
+}
+
+func newTrustedProxySet(cidrs []string) (*trustedProxySet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid trusted proxy CIDR %v", cidr)
+		}
+		nets = append(nets, n)
+	}
+	return &trustedProxySet{nets: nets}, nil
+}
+
+func (t *trustedProxySet) containsIP(ip net.IP) bool {
+	if t == nil || ip == nil {
+		return false
+	}
+	for _, n := range t.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// extractPublicIP finds the requester's address in a proxy chain,
+// preferring the RFC 7239 Forwarded header over the legacy
+// X-Forwarded-For, and falling back to the direct TCP peer when neither
+// is present. Both headers are walked right-to-left (the order hops are
+// appended to them) skipping any entry that falls inside a trusted CIDR,
+// stopping at the first untrusted one: that's the requester, since
+// anything to its right was added by a proxy we trust to have appended
+// truthfully.
+func extractPublicIP(httpReq *http.Request, trusted *trustedProxySet) net.IP {
+	if forwarded := httpReq.Header.Get(HTTPHeaderForwarded); forwarded != "" {
+		if ip := firstUntrustedIP(splitForwardedFor(forwarded), trusted); ip != nil {
+			return ip
+		}
+	}
+	if xff := httpReq.Header.Get(HTTPHeaderXForwardedFor); xff != "" {
+		if ip := firstUntrustedIP(strings.Split(xff, ","), trusted); ip != nil {
+			return ip
+		}
+	}
+	return parseIP(httpReq.RemoteAddr)
+}
+
+func firstUntrustedIP(candidates []string, trusted *trustedProxySet) net.IP {
+	for i := len(candidates) - 1; i >= 0; i-- {
+		ip := parseIP(candidates[i])
+		if ip == nil {
+			continue
+		}
+		if trusted.containsIP(ip) {
+			continue
+		}
+		return ip
+	}
+	return nil
+}
+
+// splitForwardedFor pulls the "for" parameter out of each hop of a
+// Forwarded header, e.g. `for=192.0.2.60;proto=http, for="[2001:db8::1]"`
+// becomes ["192.0.2.60", "[2001:db8::1]"].
+func splitForwardedFor(header string) []string {
+	hops := strings.Split(header, ",")
+	vals := make([]string, 0, len(hops))
+	for _, hop := range hops {
+		vals = append(vals, forwardedForValue(hop))
+	}
+	return vals
+}
+
+func forwardedForValue(hop string) string {
+	for _, pair := range strings.Split(hop, ";") {
+		kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(kv) != 2 || !strings.EqualFold(strings.TrimSpace(kv[0]), "for") {
+			continue
+		}
+		return strings.Trim(strings.TrimSpace(kv[1]), `"`)
+	}
+	return ""
+}
+
+// parseIP extracts a net.IP from a header or RemoteAddr value, which may
+// carry a port (host:port, or [host]:port for IPv6) and, for IPv6, a zone
+// ID (fe80::1%eth0).
+func parseIP(addr string) net.IP {
+	addr = strings.TrimSpace(addr)
+	if addr == "" {
+		return nil
+	}
+	addr = strings.TrimPrefix(addr, "[")
+	if i := strings.Index(addr, "]"); i >= 0 {
+		addr = addr[:i]
+	} else if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	if i := strings.Index(addr, "%"); i >= 0 {
+		addr = addr[:i]
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return nil
+	}
+	// Normalize IPv4-mapped IPv6 (::ffff:a.b.c.d) to plain IPv4 so CIDR
+	// matching and geo lookups behave the same regardless of which form
+	// a proxy happened to write.
+	if v4 := ip.To4(); v4 != nil {
+		return v4
+	}
+	return ip
+}
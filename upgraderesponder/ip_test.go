@@ -0,0 +1,92 @@
+package upgraderesponder
+
+import (
+	"net/http"
+	"testing"
+)
+
+func newTrustedProxySetForTest(t *testing.T, cidrs ...string) *trustedProxySet {
+	t.Helper()
+	set, err := newTrustedProxySet(cidrs)
+	if err != nil {
+		t.Fatalf("failed to build trusted proxy set: %v", err)
+	}
+	return set
+}
+
+func TestExtractPublicIPRejectsSpoofedXForwardedFor(t *testing.T) {
+	trusted := newTrustedProxySetForTest(t, "10.0.0.0/8")
+
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.5:54321"
+	// A malicious client can prepend anything it likes to XFF; only the
+	// entries appended by our own trusted proxies (right-most) can be
+	// believed.
+	req.Header.Set(HTTPHeaderXForwardedFor, "203.0.113.9, 198.51.100.20")
+
+	ip := extractPublicIP(req, trusted)
+	if ip == nil || ip.String() != "198.51.100.20" {
+		t.Fatalf("expected the right-most untrusted hop 198.51.100.20, got %v", ip)
+	}
+}
+
+func TestExtractPublicIPMultiProxyChain(t *testing.T) {
+	trusted := newTrustedProxySetForTest(t, "10.0.0.0/8", "192.168.0.0/16")
+
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.5:54321"
+	// client -> 198.51.100.20 (public, untrusted) -> 192.168.1.1 (trusted LB) -> 10.0.0.2 (trusted sidecar)
+	req.Header.Set(HTTPHeaderXForwardedFor, "198.51.100.20, 192.168.1.1, 10.0.0.2")
+
+	ip := extractPublicIP(req, trusted)
+	if ip == nil || ip.String() != "198.51.100.20" {
+		t.Fatalf("expected to skip over the trusted hops and land on 198.51.100.20, got %v", ip)
+	}
+}
+
+func TestExtractPublicIPFallsBackToRemoteAddr(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "203.0.113.9:443"
+
+	ip := extractPublicIP(req, nil)
+	if ip == nil || ip.String() != "203.0.113.9" {
+		t.Fatalf("expected RemoteAddr fallback 203.0.113.9, got %v", ip)
+	}
+}
+
+func TestExtractPublicIPIPv4MappedIPv6(t *testing.T) {
+	trusted := newTrustedProxySetForTest(t, "10.0.0.0/8")
+
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.5:54321"
+	req.Header.Set(HTTPHeaderXForwardedFor, "::ffff:203.0.113.9")
+
+	ip := extractPublicIP(req, trusted)
+	if ip == nil || ip.String() != "203.0.113.9" {
+		t.Fatalf("expected IPv4-mapped IPv6 to normalize to 203.0.113.9, got %v", ip)
+	}
+}
+
+func TestExtractPublicIPForwardedHeaderTakesPrecedence(t *testing.T) {
+	trusted := newTrustedProxySetForTest(t, "10.0.0.0/8")
+
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.5:54321"
+	req.Header.Set(HTTPHeaderForwarded, `for="[2001:db8::1]:8080", for=10.0.0.2`)
+	req.Header.Set(HTTPHeaderXForwardedFor, "203.0.113.9")
+
+	ip := extractPublicIP(req, trusted)
+	if ip == nil || ip.String() != "2001:db8::1" {
+		t.Fatalf("expected the Forwarded header's untrusted hop 2001:db8::1, got %v", ip)
+	}
+}
+
+func TestExtractPublicIPZoneIDStripped(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "[fe80::1%eth0]:54321"
+
+	ip := extractPublicIP(req, nil)
+	if ip == nil || ip.String() != "fe80::1" {
+		t.Fatalf("expected the zone ID to be stripped, got %v", ip)
+	}
+}
@@ -0,0 +1,89 @@
+package upgraderesponder
+
+import (
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/fsnotify/fsnotify"
+)
+
+// WatchConfigReload reloads the ResponseConfig at path whenever it changes
+// on disk or the process receives SIGHUP, and runs until done is closed.
+// It complements the explicit /reload admin endpoint (ReloadHandler) for
+// operators who'd rather `kubectl edit configmap` and have it picked up
+// automatically than trigger a reload by hand.
+func (s *Server) WatchConfigReload(path string) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+
+	go func() {
+		defer watcher.Close()
+		defer signal.Stop(sighup)
+		for {
+			select {
+			case <-s.done:
+				return
+			case <-sighup:
+				s.reloadAndLog(path, "sighup")
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				// A ConfigMap volume updates its files by swapping the
+				// "..data" symlink, so that event counts as a change too.
+				if filepath.Clean(event.Name) != filepath.Clean(path) && filepath.Base(event.Name) != "..data" {
+					continue
+				}
+				if event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+					continue
+				}
+				s.reloadAndLog(path, "fsnotify")
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logrus.WithField("component", "reload").Errorf("Config watcher error: %v", err)
+			}
+		}
+	}()
+	return nil
+}
+
+func (s *Server) reloadAndLog(path, trigger string) {
+	log := logrus.WithFields(logrus.Fields{
+		"component": "reload",
+		"trigger":   trigger,
+	})
+	if err := s.Reload(path); err != nil {
+		log.Errorf("Failed to reload config from %v: %v", path, err)
+		return
+	}
+	log.Info("Reloaded config")
+}
+
+// ReloadHandler lets an operator trigger a config reload explicitly, e.g.
+// from a deploy script that doesn't want to wait on the file watcher or
+// send signals. It is meant to be mounted on a separate admin listener,
+// not the public-facing one CheckUpgradeHandler is served on.
+func (s *Server) ReloadHandler(path string) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		if err := s.Reload(path); err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		rw.WriteHeader(http.StatusOK)
+	}
+}
@@ -1,50 +1,84 @@
 package upgraderesponder
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Masterminds/semver"
 	"github.com/Sirupsen/logrus"
-	influxcli "github.com/influxdata/influxdb/client/v2"
 	maxminddb "github.com/oschwald/maxminddb-golang"
 	"github.com/pkg/errors"
 )
 
 const (
-	VersionTagLatest       = "latest"
-	LonghornMinimalVersion = "v0.0.1"
+	VersionTagLatest = "latest"
+
+	// DefaultMinimalVersion is the Application.MinimalVersion of an
+	// application that doesn't declare its own, and so is used as the
+	// requester's version when such an application receives a request
+	// with a missing or unparseable version.
+	DefaultMinimalVersion = "v0.0.1"
+
+	// RequestTagChannel is the ExtraInfo key a client uses to select which
+	// tagged release train (e.g. "stable", "beta", "dev") to compute the
+	// upgrade path against. Defaults to VersionTagLatest. It is always
+	// accepted, regardless of the application's ExtraTagSchema.
+	RequestTagChannel = "channel"
 
 	// ns is good for counting nodes
 	InfluxDBPrecisionNanosecond = "ns"
-	InfluxDBDatabase            = "longhorn_upgrade_responder"
-
-	InfluxDBMeasurementName = "longhorn_upgrade_query"
 )
 
 var (
-	InfluxDBTagLonghornVersion        = "longhorn_version"
+	InfluxDBTagAppVersion             = "app_version"
 	InfluxDBTagKubernetesVersion      = "kubernetes_version"
 	InfluxDBTagLocationCity           = "city"
 	InfluxDBTagLocationCountry        = "country"
 	InfluxDBTagLocationCountryISOCode = "country_isocode"
 
 	HTTPHeaderXForwardedFor = "X-Forwarded-For"
+	HTTPHeaderForwarded     = "Forwarded"
 	HTTPHeaderRequestID     = "X-Request-ID"
 )
 
 type Server struct {
-	done          chan struct{}
-	VersionMap    map[string]*Version
-	TagVersionMap map[string]*Version
-	influxClient  influxcli.Client
-	db            *maxminddb.Reader
+	done chan struct{}
+
+	// stateMu guards state, which is swapped wholesale on every
+	// successful Reload rather than mutated in place, so readers only
+	// need to hold stateMu for the instant it takes to grab the current
+	// pointer.
+	stateMu sync.RWMutex
+	state   *versionState
+
+	trustedProxies *trustedProxySet
+	sink           MetricsSink
+	db             *maxminddb.Reader
+}
+
+// versionState is everything loadResponseConfig derives from a
+// ResponseConfig. It's held behind Server.stateMu and replaced atomically
+// by Reload so in-flight requests never see a half-updated config.
+type versionState struct {
+	application      Application
+	versionMap       map[string]*Version
+	tagVersionMap    map[string]*Version
+	excludedVersions map[string]bool
+}
+
+func (s *Server) currentState() *versionState {
+	s.stateMu.RLock()
+	defer s.stateMu.RUnlock()
+	return s.state
 }
 
 type Location struct {
@@ -55,137 +89,209 @@ type Location struct {
 	} `json:"country"`
 }
 
+func (l *Location) countryName() string {
+	if l == nil {
+		return ""
+	}
+	return l.Country.Name
+}
+
+// Application describes the product this responder instance serves
+// upgrade checks for, so that a single binary can be reused across
+// products instead of hardcoding one product's name and fields.
+type Application struct {
+	// Name identifies the application and derives the default InfluxDB
+	// database and measurement names ("<name>_upgrade_responder" and
+	// "<name>_upgrade_query").
+	Name string `json:"name"`
+
+	// MinimalVersion is used in place of the requester's version when it
+	// is missing or fails to parse as semver. Defaults to
+	// DefaultMinimalVersion.
+	MinimalVersion string `json:"minimalVersion,omitempty"`
+
+	// ExtraTagSchema lists the ExtraInfo keys this application accepts.
+	// A request carrying a key outside this schema (and outside the
+	// built-in RequestTagChannel) is rejected.
+	ExtraTagSchema []string `json:"extraTagSchema,omitempty"`
+}
+
 type ResponseConfig struct {
-	Versions []Version
+	Application Application
+	Versions    []Version
 }
 
 type Version struct {
 	Name        string // must be in semantic versioning
 	ReleaseDate string
 	Tags        []string
+
+	// MinUpgradableFrom, when set, is a semver constraint (e.g. ">=v1.0.0")
+	// that the requester's current version must satisfy before this
+	// version is offered as an upgrade target.
+	MinUpgradableFrom string `json:"minUpgradableFrom,omitempty"`
+
+	// Supersedes lists version names made obsolete by this one. A
+	// superseded version is never returned as an upgrade target, even if
+	// it would otherwise fall on the upgrade path.
+	Supersedes []string `json:"supersedes,omitempty"`
+
+	// Skip lists version names that must never be recommended as an
+	// upgrade target, e.g. a release that was pulled after the fact
+	// because of a bug.
+	Skip []string `json:"skip,omitempty"`
 }
 
 type CheckUpgradeRequest struct {
-	LonghornVersion   string `json:"longhornVersion"`
+	AppVersion        string `json:"appVersion"`
 	KubernetesVersion string `json:"kubernetesVersion"`
+
+	// ExtraInfo carries additional request dimensions, validated against
+	// the application's ExtraTagSchema, e.g. {"channel": "stable"} to
+	// select which tagged release train to upgrade along.
+	ExtraInfo map[string]string `json:"extraInfo,omitempty"`
 }
 
 type CheckUpgradeResponse struct {
 	Versions []Version `json:"versions"`
 }
 
-func NewServer(done chan struct{}, configFile, influxURL, influxUser, influxPass, geodb string) (*Server, error) {
-	path := filepath.Clean(configFile)
-	f, err := os.Open(path)
-	if err != nil {
+func NewServer(done chan struct{}, configFile string, metricsConfig MetricsConfig, geodb string, trustedProxies []string) (*Server, error) {
+	s := &Server{done: done}
+	if err := s.Reload(configFile); err != nil {
 		return nil, err
 	}
-	defer f.Close()
 
-	var config ResponseConfig
-	if err := json.NewDecoder(f).Decode(&config); err != nil {
-		return nil, err
-	}
-	s := &Server{
-		done:          done,
-		VersionMap:    map[string]*Version{},
-		TagVersionMap: map[string]*Version{},
-	}
-	if err := s.validateAndLoadResponseConfig(&config); err != nil {
+	proxies, err := newTrustedProxySet(trustedProxies)
+	if err != nil {
 		return nil, err
 	}
+	s.trustedProxies = proxies
+
+	startupLog := logrus.WithField("component", "startup")
 
 	db, err := maxminddb.Open(geodb)
 	if err != nil {
 		return nil, err
 	}
 	s.db = db
-	logrus.Debugf("GeoDB opened")
-
-	if influxURL != "" {
-		cfg := influxcli.HTTPConfig{
-			Addr:               influxURL,
-			InsecureSkipVerify: true,
-		}
-		if influxUser != "" {
-			cfg.Username = influxUser
-		}
-		if influxPass != "" {
-			cfg.Password = influxPass
-		}
-		c, err := influxcli.NewHTTPClient(cfg)
-		if err != nil {
-			return nil, err
-		}
-		logrus.Debugf("InfluxDB connection established")
+	startupLog.Debug("GeoDB opened")
 
-		s.influxClient = c
-		if err := s.initDB(); err != nil {
-			return nil, err
-		}
+	appName := s.currentState().application.Name
+	if metricsConfig.InfluxDBDatabase == "" {
+		metricsConfig.InfluxDBDatabase = appName + "_upgrade_responder"
+	}
+	if metricsConfig.Measurement == "" {
+		metricsConfig.Measurement = appName + "_upgrade_query"
+	}
+	sink, err := NewMetricsSink(metricsConfig)
+	if err != nil {
+		return nil, err
 	}
+	s.sink = sink
+	startupLog.Debugf("Metrics sink %v initialized", metricsConfig.Backend)
+
 	go func() {
 		<-done
 		if err := s.db.Close(); err != nil {
-			logrus.Debugf("Failed to close geodb: %v", err)
+			startupLog.Debugf("Failed to close geodb: %v", err)
 		} else {
-			logrus.Debugf("Geodb connection closed")
+			startupLog.Debug("Geodb connection closed")
 		}
-		if s.influxClient != nil {
-			if err := s.influxClient.Close(); err != nil {
-				logrus.Debugf("Failed to close InfluxDB connection: %v", err)
-			} else {
-				logrus.Debug("InfluxDB connection closed")
-			}
+		if err := s.sink.Close(); err != nil {
+			startupLog.Debugf("Failed to close metrics sink: %v", err)
+		} else {
+			startupLog.Debug("Metrics sink closed")
 		}
 	}()
 	return s, nil
 }
 
-func (s *Server) initDB() error {
-	if err := s.createDB(InfluxDBDatabase); err != nil {
-		return err
+// loadResponseConfig validates config and builds the versionState it
+// describes. It touches no Server fields so it's safe to run against a
+// candidate config before committing to a Reload.
+func loadResponseConfig(config *ResponseConfig) (*versionState, error) {
+	if config.Application.Name == "" {
+		return nil, fmt.Errorf("application name must be specified")
 	}
-	return nil
-}
-
-func (s *Server) createDB(name string) error {
-	q := influxcli.NewQuery("CREATE DATABASE "+name, "", "")
-	response, err := s.influxClient.Query(q)
-	if err != nil {
-		return err
+	if config.Application.MinimalVersion == "" {
+		config.Application.MinimalVersion = DefaultMinimalVersion
 	}
-	if response.Error() != nil {
-		return response.Error()
+	if _, err := semver.NewVersion(config.Application.MinimalVersion); err != nil {
+		return nil, errors.Wrapf(err, "invalid application minimal version %v", config.Application.MinimalVersion)
 	}
-	return nil
-}
 
-func (s *Server) validateAndLoadResponseConfig(config *ResponseConfig) error {
-	for _, v := range config.Versions {
+	state := &versionState{
+		application:      config.Application,
+		versionMap:       map[string]*Version{},
+		tagVersionMap:    map[string]*Version{},
+		excludedVersions: map[string]bool{},
+	}
+
+	for i := range config.Versions {
+		v := &config.Versions[i]
 		if len(v.Tags) == 0 {
-			return fmt.Errorf("invalid empty label for %v", v)
+			return nil, fmt.Errorf("invalid empty label for %v", v)
 		}
-		if s.VersionMap[v.Name] != nil {
-			return fmt.Errorf("invalid duplicate name %v", v.Name)
+		if state.versionMap[v.Name] != nil {
+			return nil, fmt.Errorf("invalid duplicate name %v", v.Name)
 		}
 		if _, err := semver.NewVersion(v.Name); err != nil {
-			return err
+			return nil, err
 		}
 		if _, err := ParseTime(v.ReleaseDate); err != nil {
-			return err
+			return nil, err
 		}
 		for _, l := range v.Tags {
-			if s.TagVersionMap[l] != nil {
-				return fmt.Errorf("invalid duplicate label %v", l)
+			if state.tagVersionMap[l] != nil {
+				return nil, fmt.Errorf("invalid duplicate label %v", l)
 			}
-			s.TagVersionMap[l] = &v
+			state.tagVersionMap[l] = v
 		}
-		s.VersionMap[v.Name] = &v
+		if v.MinUpgradableFrom != "" {
+			if _, err := semver.NewConstraint(v.MinUpgradableFrom); err != nil {
+				return nil, errors.Wrapf(err, "invalid minUpgradableFrom constraint for version %v", v.Name)
+			}
+		}
+		state.versionMap[v.Name] = v
+	}
+	if state.tagVersionMap[VersionTagLatest] == nil {
+		return nil, fmt.Errorf("no latest label specified")
+	}
+	for _, v := range config.Versions {
+		for _, excluded := range v.Supersedes {
+			state.excludedVersions[excluded] = true
+		}
+		for _, excluded := range v.Skip {
+			state.excludedVersions[excluded] = true
+		}
+	}
+	return state, nil
+}
+
+// Reload re-reads and validates the ResponseConfig at path and, on
+// success, atomically swaps it in for the version state every in-flight
+// and future request sees. A bad config on disk leaves the current state
+// untouched and is returned as an error.
+func (s *Server) Reload(path string) error {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var config ResponseConfig
+	if err := json.NewDecoder(f).Decode(&config); err != nil {
+		return err
 	}
-	if s.TagVersionMap[VersionTagLatest] == nil {
-		return fmt.Errorf("no latest label specified")
+	state, err := loadResponseConfig(&config)
+	if err != nil {
+		return err
 	}
+
+	s.stateMu.Lock()
+	s.state = state
+	s.stateMu.Unlock()
 	return nil
 }
 
@@ -193,12 +299,23 @@ func (s *Server) HealthCheck(rw http.ResponseWriter, req *http.Request) {
 	rw.WriteHeader(http.StatusOK)
 }
 
+// HealthCheckHandler is HealthCheck wrapped with request-ID and access-log
+// middleware. Register this instead of HealthCheck directly.
+func (s *Server) HealthCheckHandler() http.HandlerFunc {
+	return WithRequestID("health_check", s.HealthCheck)
+}
+
 func (s *Server) CheckUpgrade(rw http.ResponseWriter, req *http.Request) {
 	var (
 		err       error
 		checkReq  CheckUpgradeRequest
 		checkResp *CheckUpgradeResponse
 	)
+	ctx := req.Context()
+	log := logrus.WithFields(logrus.Fields{
+		"request_id": requestIDFromContext(ctx),
+		"component":  "check_upgrade",
+	})
 
 	defer func() {
 		if err != nil {
@@ -210,21 +327,27 @@ func (s *Server) CheckUpgrade(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	s.recordRequest(req, &checkReq)
+	s.recordRequest(ctx, req, &checkReq)
 
-	checkResp, err = s.GenerateCheckUpgradeResponse(&checkReq)
+	checkResp, err = s.GenerateCheckUpgradeResponse(ctx, &checkReq)
 	if err != nil {
-		logrus.Errorf("Failed to GenerateCheckUpgradeResponse: %v", err)
+		log.Errorf("Failed to GenerateCheckUpgradeResponse: %v", err)
 		return
 	}
 
 	if err = respondWithJSON(rw, checkResp); err != nil {
-		logrus.Errorf("Failed to repsondWithJSON: %v", err)
+		log.Errorf("Failed to repsondWithJSON: %v", err)
 		return
 	}
 	return
 }
 
+// CheckUpgradeHandler is CheckUpgrade wrapped with request-ID and access-log
+// middleware. Register this instead of CheckUpgrade directly.
+func (s *Server) CheckUpgradeHandler() http.HandlerFunc {
+	return WithRequestID("check_upgrade", s.CheckUpgrade)
+}
+
 func respondWithJSON(rw http.ResponseWriter, obj interface{}) error {
 	response, err := json.Marshal(obj)
 	if err != nil {
@@ -236,8 +359,29 @@ func respondWithJSON(rw http.ResponseWriter, obj interface{}) error {
 	return err
 }
 
-func (s *Server) getParsedVersionWithTag(tag string) (*semver.Version, *Version, error) {
-	v, exists := s.TagVersionMap[tag]
+// validateExtraInfo rejects any ExtraInfo key that isn't RequestTagChannel
+// and isn't declared in the application's ExtraTagSchema.
+func (s *Server) validateExtraInfo(state *versionState, extraInfo map[string]string) error {
+	for key := range extraInfo {
+		if key == RequestTagChannel {
+			continue
+		}
+		allowed := false
+		for _, schemaKey := range state.application.ExtraTagSchema {
+			if key == schemaKey {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("extraInfo key %v is not declared in the %v application's extraTagSchema", key, state.application.Name)
+		}
+	}
+	return nil
+}
+
+func (s *Server) getParsedVersionWithTag(state *versionState, tag string) (*semver.Version, *Version, error) {
+	v, exists := state.tagVersionMap[tag]
 	if !exists {
 		return nil, nil, fmt.Errorf("cannot find version with tag %v", tag)
 	}
@@ -248,35 +392,100 @@ func (s *Server) getParsedVersionWithTag(tag string) (*semver.Version, *Version,
 	return ver, v, nil
 }
 
-func (s *Server) GenerateCheckUpgradeResponse(request *CheckUpgradeRequest) (*CheckUpgradeResponse, error) {
-	/* disable version dependency reseponse
-	reqVer, err := semver.NewVersion(request.LonghornVersion)
+func (s *Server) GenerateCheckUpgradeResponse(ctx context.Context, request *CheckUpgradeRequest) (*CheckUpgradeResponse, error) {
+	resp := &CheckUpgradeResponse{}
+	log := logrus.WithFields(logrus.Fields{
+		"request_id":  requestIDFromContext(ctx),
+		"app_version": request.AppVersion,
+		"component":   "check_upgrade",
+	})
+
+	state := s.currentState()
+
+	if err := s.validateExtraInfo(state, request.ExtraInfo); err != nil {
+		return nil, err
+	}
+
+	reqVer, err := semver.NewVersion(request.AppVersion)
 	if err != nil {
-		logrus.Warnf("Invalid version in request: %v: %v, response with the latest version", request.LonghornVersion, err)
-		reqVer, err = semver.NewVersion(LonghornMinimalVersion)
+		log.Warnf("Invalid version in request: %v, responding with the upgrade path from the application's minimal version", err)
+		reqVer, err = semver.NewVersion(state.application.MinimalVersion)
 		if err != nil {
 			return nil, err
 		}
 	}
-	*/
-	resp := &CheckUpgradeResponse{}
 
-	// Only supports `latest` label for now
-	//latestVer, version, err := s.getParsedVersionWithTag(VersionTagLatest)
-	_, version, err := s.getParsedVersionWithTag(VersionTagLatest)
+	channel := request.ExtraInfo[RequestTagChannel]
+	if channel == "" {
+		channel = VersionTagLatest
+	}
+	if _, exists := state.tagVersionMap[channel]; !exists {
+		return nil, fmt.Errorf("unknown channel %v", channel)
+	}
+
+	targetVer, _, err := s.getParsedVersionWithTag(state, channel)
 	if err != nil {
-		logrus.Errorf("BUG: unable to get an valid tag for %v: %v", VersionTagLatest, err)
+		log.Errorf("BUG: unable to get an valid tag for %v: %v", channel, err)
 		return nil, err
 	}
-	/* disable version dependency reseponse
-	if reqVer.LessThan(latestVer) {
-		resp.Versions = append(resp.Versions, *version)
+
+	// Already on or past the target: nothing to recommend, and in
+	// particular never suggest a downgrade.
+	if !targetVer.GreaterThan(reqVer) {
+		return resp, nil
+	}
+
+	path, err := s.buildUpgradePath(state, reqVer, targetVer)
+	if err != nil {
+		return nil, err
 	}
-	*/
-	resp.Versions = append(resp.Versions, *version)
+	resp.Versions = path
 	return resp, nil
 }
 
+// buildUpgradePath returns every version strictly newer than reqVer and no
+// newer than targetVer, in ascending semver order, that is safe to
+// recommend: it isn't superseded or skip-listed, and the requester's
+// current version satisfies its MinUpgradableFrom constraint (if any).
+func (s *Server) buildUpgradePath(state *versionState, reqVer, targetVer *semver.Version) ([]Version, error) {
+	type step struct {
+		ver *semver.Version
+		v   *Version
+	}
+	var steps []step
+	for name, v := range state.versionMap {
+		if state.excludedVersions[name] {
+			continue
+		}
+		ver, err := semver.NewVersion(name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid version name %v in versionMap", name)
+		}
+		if !ver.GreaterThan(reqVer) || ver.GreaterThan(targetVer) {
+			continue
+		}
+		if v.MinUpgradableFrom != "" {
+			constraint, err := semver.NewConstraint(v.MinUpgradableFrom)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid minUpgradableFrom constraint for version %v", name)
+			}
+			if !constraint.Check(reqVer) {
+				continue
+			}
+		}
+		steps = append(steps, step{ver, v})
+	}
+	sort.Slice(steps, func(i, j int) bool {
+		return steps[i].ver.LessThan(steps[j].ver)
+	})
+
+	path := make([]Version, 0, len(steps))
+	for _, st := range steps {
+		path = append(path, *st.v)
+	}
+	return path, nil
+}
+
 func ParseTime(t string) (time.Time, error) {
 	return time.Parse(time.RFC3339, t)
 }
@@ -291,15 +500,15 @@ type locationRecord struct {
 	} `maxminddb:"country"`
 }
 
-func (s *Server) getLocation(addr string) (*Location, error) {
+func (s *Server) getLocation(ip net.IP) (*Location, error) {
+	if ip == nil {
+		return nil, fmt.Errorf("no IP address to look up")
+	}
 	var (
 		record locationRecord
 		loc    Location
 	)
-	ip := net.ParseIP(addr)
-
-	err := s.db.Lookup(ip, &record)
-	if err != nil {
+	if err := s.db.Lookup(ip, &record); err != nil {
 		return nil, err
 	}
 
@@ -314,69 +523,40 @@ func canonializeField(name string) string {
 }
 
 // Don't need to return error to the requester
-func (s *Server) recordRequest(httpReq *http.Request, req *CheckUpgradeRequest) {
-	xForwaredFor := httpReq.Header[HTTPHeaderXForwardedFor]
-	requestID := httpReq.Header[HTTPHeaderRequestID]
-	publicIP := ""
-	l := len(xForwaredFor)
-	if l != 0 {
-		// rightmost IP must be the public IP
-		publicIP = xForwaredFor[l-1]
-	}
+func (s *Server) recordRequest(ctx context.Context, httpReq *http.Request, req *CheckUpgradeRequest) {
+	requestID := requestIDFromContext(ctx)
+	log := logrus.WithFields(logrus.Fields{
+		"request_id":  requestID,
+		"remote_ip":   httpReq.RemoteAddr,
+		"app_version": req.AppVersion,
+		"component":   "record_request",
+	})
+
+	publicIP := extractPublicIP(httpReq, s.trustedProxies)
 
 	// We use IP to find the location but we don't store IP
 	loc, err := s.getLocation(publicIP)
 	if err != nil {
-		logrus.Errorf("Failed to get location for one ip")
+		log.Errorf("Failed to get location for one ip: %v", err)
 	}
-	logrus.Debugf("HTTP request: RequestID \"%v\", Location %+v, req %v",
-		requestID, loc, req)
-
-	if s.influxClient != nil {
-		var (
-			err error
-			pt  *influxcli.Point
-		)
-		defer func() {
-			if err != nil {
-				logrus.Errorf("Failed to recordRequest: %v", err)
-			}
-		}()
+	log.WithField("country", loc.countryName()).Debugf("Recording upgrade check, req %+v", req)
 
-		tags := map[string]string{
-			InfluxDBTagLonghornVersion:   req.LonghornVersion,
-			InfluxDBTagKubernetesVersion: req.KubernetesVersion,
-		}
-		fields := map[string]interface{}{
-			canonializeField(HTTPHeaderRequestID): requestID,
-		}
-		if loc != nil {
-			tags[InfluxDBTagLocationCity] = loc.City
-			tags[InfluxDBTagLocationCountry] = loc.Country.Name
-			tags[InfluxDBTagLocationCountryISOCode] = loc.Country.ISOCode
-		}
-		pt, err = influxcli.NewPoint(InfluxDBMeasurementName, tags, fields, time.Now())
-		if err != nil {
-			return
-		}
-
-		if err = s.addPoint(pt, InfluxDBDatabase, InfluxDBPrecisionNanosecond); err != nil {
-			return
-		}
+	tags := map[string]string{
+		InfluxDBTagAppVersion:        req.AppVersion,
+		InfluxDBTagKubernetesVersion: req.KubernetesVersion,
 	}
-}
-
-func (s *Server) addPoint(pt *influxcli.Point, db, precision string) error {
-	bp, err := influxcli.NewBatchPoints(influxcli.BatchPointsConfig{
-		Database:  db,
-		Precision: precision,
-	})
-	if err != nil {
-		return err
+	for key, value := range req.ExtraInfo {
+		tags[key] = value
 	}
-	bp.AddPoint(pt)
-	if err = s.influxClient.Write(bp); err != nil {
-		return err
+	fields := map[string]interface{}{
+		canonializeField(HTTPHeaderRequestID): requestID,
+	}
+	if loc != nil {
+		tags[InfluxDBTagLocationCity] = loc.City
+		tags[InfluxDBTagLocationCountry] = loc.Country.Name
+		tags[InfluxDBTagLocationCountryISOCode] = loc.Country.ISOCode
+	}
+	if err := s.sink.RecordUpgradeCheck(tags, fields, time.Now()); err != nil {
+		log.Errorf("Failed to recordRequest: %v", err)
 	}
-	return nil
 }
@@ -0,0 +1,108 @@
+package upgraderesponder
+
+import (
+	"context"
+	"testing"
+)
+
+func newTestServer(t *testing.T, versions []Version) *Server {
+	config := &ResponseConfig{
+		Application: Application{Name: "test-app"},
+		Versions:    versions,
+	}
+	state, err := loadResponseConfig(config)
+	if err != nil {
+		t.Fatalf("failed to load test config: %v", err)
+	}
+	return &Server{state: state}
+}
+
+func versionNames(versions []Version) []string {
+	names := make([]string, 0, len(versions))
+	for _, v := range versions {
+		names = append(names, v.Name)
+	}
+	return names
+}
+
+func TestGenerateCheckUpgradeResponseSuppressesDowngrade(t *testing.T) {
+	s := newTestServer(t, []Version{
+		{Name: "v1.0.0", ReleaseDate: "2020-01-01T00:00:00Z", Tags: []string{VersionTagLatest}},
+	})
+
+	resp, err := s.GenerateCheckUpgradeResponse(context.Background(), &CheckUpgradeRequest{AppVersion: "v1.1.0"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Versions) != 0 {
+		t.Fatalf("expected no upgrade path for a client already past latest, got %v", versionNames(resp.Versions))
+	}
+
+	resp, err = s.GenerateCheckUpgradeResponse(context.Background(), &CheckUpgradeRequest{AppVersion: "v1.0.0"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Versions) != 0 {
+		t.Fatalf("expected no upgrade path for a client already on latest, got %v", versionNames(resp.Versions))
+	}
+}
+
+func TestGenerateCheckUpgradeResponsePrereleaseOrdering(t *testing.T) {
+	s := newTestServer(t, []Version{
+		{Name: "v1.1.0-rc1", ReleaseDate: "2020-01-01T00:00:00Z", Tags: []string{"dev"}},
+		{Name: "v1.0.0", ReleaseDate: "2019-12-01T00:00:00Z", Tags: []string{VersionTagLatest}},
+	})
+
+	resp, err := s.GenerateCheckUpgradeResponse(context.Background(), &CheckUpgradeRequest{
+		AppVersion: "v1.0.0-beta1",
+		ExtraInfo:  map[string]string{RequestTagChannel: "dev"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	names := versionNames(resp.Versions)
+	if len(names) != 2 || names[0] != "v1.0.0" || names[1] != "v1.1.0-rc1" {
+		t.Fatalf("expected [v1.0.0 v1.1.0-rc1] in order, got %v", names)
+	}
+}
+
+func TestGenerateCheckUpgradeResponseRejectsUndeclaredExtraInfoKey(t *testing.T) {
+	s := newTestServer(t, []Version{
+		{Name: "v1.0.0", ReleaseDate: "2020-01-01T00:00:00Z", Tags: []string{VersionTagLatest}},
+	})
+
+	_, err := s.GenerateCheckUpgradeResponse(context.Background(), &CheckUpgradeRequest{
+		AppVersion: "v0.9.0",
+		ExtraInfo:  map[string]string{"arch": "amd64"},
+	})
+	if err == nil {
+		t.Fatalf("expected an error for an ExtraInfo key outside the application's extraTagSchema")
+	}
+}
+
+func TestGenerateCheckUpgradeResponseMultiHopChain(t *testing.T) {
+	s := newTestServer(t, []Version{
+		{Name: "v1.0.0", ReleaseDate: "2020-01-01T00:00:00Z", Tags: []string{"v1.0"}},
+		{Name: "v1.1.0", ReleaseDate: "2020-02-01T00:00:00Z", Tags: []string{"v1.1"}, Skip: []string{"v1.0.5"}},
+		{Name: "v1.0.5", ReleaseDate: "2020-01-15T00:00:00Z", Tags: []string{"v1.0.5-channel"}},
+		{Name: "v2.0.0", ReleaseDate: "2020-03-01T00:00:00Z", Tags: []string{VersionTagLatest}, MinUpgradableFrom: ">=v1.1.0"},
+	})
+
+	resp, err := s.GenerateCheckUpgradeResponse(context.Background(), &CheckUpgradeRequest{AppVersion: "v1.0.0"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	names := versionNames(resp.Versions)
+	if len(names) != 1 || names[0] != "v1.1.0" {
+		t.Fatalf("expected the path to stop at v1.1.0 because v2.0.0 requires >=v1.1.0 and v1.0.5 is skip-listed, got %v", names)
+	}
+
+	resp, err = s.GenerateCheckUpgradeResponse(context.Background(), &CheckUpgradeRequest{AppVersion: "v1.1.0"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	names = versionNames(resp.Versions)
+	if len(names) != 1 || names[0] != "v2.0.0" {
+		t.Fatalf("expected a client on v1.1.0 to be offered v2.0.0 directly, got %v", names)
+	}
+}
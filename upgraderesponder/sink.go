@@ -0,0 +1,226 @@
+package upgraderesponder
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	influxdb2api "github.com/influxdata/influxdb-client-go/v2/api"
+	influxcli "github.com/influxdata/influxdb/client/v2"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	MetricsBackendNone       = "none"
+	MetricsBackendInfluxDB   = "influxdb"
+	MetricsBackendInfluxDB2  = "influxdb2"
+	MetricsBackendPrometheus = "prometheus"
+
+	PrometheusMetricName = "upgrade_request_total"
+)
+
+// MetricsSink records one upgrade check as a set of tags and fields. Tags are
+// dimensions suitable for grouping/filtering (e.g. version, country), fields
+// are the measured values (e.g. the request ID). Implementations must be
+// safe for concurrent use.
+type MetricsSink interface {
+	RecordUpgradeCheck(tags map[string]string, fields map[string]interface{}, ts time.Time) error
+	Close() error
+}
+
+// MetricsConfig selects and configures the MetricsSink a Server records to.
+type MetricsConfig struct {
+	Backend string
+
+	InfluxDBURL      string
+	InfluxDBUser     string
+	InfluxDBPass     string
+	InfluxDBDatabase string
+
+	InfluxDB2URL    string
+	InfluxDB2Token  string
+	InfluxDB2Org    string
+	InfluxDB2Bucket string
+
+	// Measurement names the InfluxDB measurement (v1 or v2) upgrade
+	// checks are written to.
+	Measurement string
+}
+
+// NewMetricsSink constructs the MetricsSink selected by cfg.Backend.
+func NewMetricsSink(cfg MetricsConfig) (MetricsSink, error) {
+	switch cfg.Backend {
+	case "", MetricsBackendNone:
+		return &noopSink{}, nil
+	case MetricsBackendInfluxDB:
+		return newInfluxDBSink(cfg.InfluxDBURL, cfg.InfluxDBUser, cfg.InfluxDBPass, cfg.InfluxDBDatabase, cfg.Measurement)
+	case MetricsBackendInfluxDB2:
+		return newInfluxDB2Sink(cfg.InfluxDB2URL, cfg.InfluxDB2Token, cfg.InfluxDB2Org, cfg.InfluxDB2Bucket, cfg.Measurement)
+	case MetricsBackendPrometheus:
+		return newPrometheusSink(), nil
+	default:
+		return nil, fmt.Errorf("unknown metrics backend %v", cfg.Backend)
+	}
+}
+
+// noopSink discards every record. Used for offline testing and for
+// deployments that don't want telemetry recorded anywhere.
+type noopSink struct{}
+
+func (s *noopSink) RecordUpgradeCheck(tags map[string]string, fields map[string]interface{}, ts time.Time) error {
+	return nil
+}
+
+func (s *noopSink) Close() error {
+	return nil
+}
+
+// influxDBSink writes to an InfluxDB v1 server, as the Server used to do
+// directly.
+type influxDBSink struct {
+	client      influxcli.Client
+	database    string
+	measurement string
+}
+
+func newInfluxDBSink(url, user, pass, database, measurement string) (*influxDBSink, error) {
+	cfg := influxcli.HTTPConfig{
+		Addr:               url,
+		InsecureSkipVerify: true,
+	}
+	if user != "" {
+		cfg.Username = user
+	}
+	if pass != "" {
+		cfg.Password = pass
+	}
+	client, err := influxcli.NewHTTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	s := &influxDBSink{
+		client:      client,
+		database:    database,
+		measurement: measurement,
+	}
+	if err := s.createDatabase(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *influxDBSink) createDatabase() error {
+	q := influxcli.NewQuery("CREATE DATABASE "+s.database, "", "")
+	response, err := s.client.Query(q)
+	if err != nil {
+		return err
+	}
+	if response.Error() != nil {
+		return response.Error()
+	}
+	return nil
+}
+
+func (s *influxDBSink) RecordUpgradeCheck(tags map[string]string, fields map[string]interface{}, ts time.Time) error {
+	pt, err := influxcli.NewPoint(s.measurement, tags, fields, ts)
+	if err != nil {
+		return err
+	}
+	bp, err := influxcli.NewBatchPoints(influxcli.BatchPointsConfig{
+		Database:  s.database,
+		Precision: InfluxDBPrecisionNanosecond,
+	})
+	if err != nil {
+		return err
+	}
+	bp.AddPoint(pt)
+	return s.client.Write(bp)
+}
+
+func (s *influxDBSink) Close() error {
+	return s.client.Close()
+}
+
+// influxDB2Sink writes to an InfluxDB v2 server, which uses token auth and
+// org/bucket in place of v1's database/retention-policy pair.
+type influxDB2Sink struct {
+	client      influxdb2.Client
+	writeAPI    influxdb2api.WriteAPIBlocking
+	measurement string
+}
+
+func newInfluxDB2Sink(url, token, org, bucket, measurement string) (*influxDB2Sink, error) {
+	client := influxdb2.NewClient(url, token)
+	return &influxDB2Sink{
+		client:      client,
+		writeAPI:    client.WriteAPIBlocking(org, bucket),
+		measurement: measurement,
+	}, nil
+}
+
+func (s *influxDB2Sink) RecordUpgradeCheck(tags map[string]string, fields map[string]interface{}, ts time.Time) error {
+	pt := influxdb2.NewPoint(s.measurement, tags, fields, ts)
+	return errors.Wrap(s.writeAPI.WritePoint(context.Background(), pt), "failed to write point to InfluxDB v2")
+}
+
+func (s *influxDB2Sink) Close() error {
+	s.client.Close()
+	return nil
+}
+
+// prometheusSink exposes upgrade check counts as Prometheus counters instead
+// of pushing them to a time-series database, for clusters that scrape
+// metrics rather than running InfluxDB.
+type prometheusSink struct {
+	registry *prometheus.Registry
+	counter  *prometheus.CounterVec
+}
+
+func newPrometheusSink() *prometheusSink {
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: PrometheusMetricName,
+		Help: "Total number of upgrade checks received, by version and requester location",
+	}, []string{"version", "kubernetes_version", "country", "city"})
+
+	// A dedicated registry, rather than the global default one, so that
+	// constructing a second Prometheus-backed Server in the same process
+	// (e.g. parallel tests) doesn't panic on duplicate registration.
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(counter)
+	return &prometheusSink{registry: registry, counter: counter}
+}
+
+func (s *prometheusSink) RecordUpgradeCheck(tags map[string]string, fields map[string]interface{}, ts time.Time) error {
+	s.counter.With(prometheus.Labels{
+		"version":            tags[InfluxDBTagAppVersion],
+		"kubernetes_version": tags[InfluxDBTagKubernetesVersion],
+		"country":            tags[InfluxDBTagLocationCountry],
+		"city":               tags[InfluxDBTagLocationCity],
+	}).Inc()
+	return nil
+}
+
+func (s *prometheusSink) Close() error {
+	return nil
+}
+
+// Handler serves this sink's registry in the Prometheus exposition format.
+// Only the Prometheus sink has one; see Server.MetricsHandler.
+func (s *prometheusSink) Handler() http.Handler {
+	return promhttp.HandlerFor(s.registry, promhttp.HandlerOpts{})
+}
+
+// MetricsHandler returns the HTTP handler that should be mounted at /metrics,
+// or nil if the configured sink doesn't expose one (e.g. it pushes to
+// InfluxDB instead of being scraped).
+func (s *Server) MetricsHandler() http.Handler {
+	if ps, ok := s.sink.(*prometheusSink); ok {
+		return ps.Handler()
+	}
+	return nil
+}
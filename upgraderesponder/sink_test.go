@@ -0,0 +1,76 @@
+package upgraderesponder
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestNewMetricsSinkSelectsBackend(t *testing.T) {
+	sink, err := NewMetricsSink(MetricsConfig{})
+	if err != nil {
+		t.Fatalf("unexpected error for the default (none) backend: %v", err)
+	}
+	if _, ok := sink.(*noopSink); !ok {
+		t.Fatalf("expected a noopSink for an empty backend, got %T", sink)
+	}
+
+	sink, err = NewMetricsSink(MetricsConfig{Backend: MetricsBackendNone})
+	if err != nil {
+		t.Fatalf("unexpected error for backend %v: %v", MetricsBackendNone, err)
+	}
+	if _, ok := sink.(*noopSink); !ok {
+		t.Fatalf("expected a noopSink for backend %v, got %T", MetricsBackendNone, sink)
+	}
+
+	sink, err = NewMetricsSink(MetricsConfig{Backend: MetricsBackendPrometheus})
+	if err != nil {
+		t.Fatalf("unexpected error for backend %v: %v", MetricsBackendPrometheus, err)
+	}
+	if _, ok := sink.(*prometheusSink); !ok {
+		t.Fatalf("expected a prometheusSink for backend %v, got %T", MetricsBackendPrometheus, sink)
+	}
+}
+
+func TestNewMetricsSinkRejectsUnknownBackend(t *testing.T) {
+	_, err := NewMetricsSink(MetricsConfig{Backend: "bogus"})
+	if err == nil {
+		t.Fatalf("expected an error for an unknown metrics backend")
+	}
+}
+
+func TestNoopSinkRecordUpgradeCheck(t *testing.T) {
+	sink := &noopSink{}
+	if err := sink.RecordUpgradeCheck(map[string]string{"version": "v1.0.0"}, nil, time.Now()); err != nil {
+		t.Fatalf("unexpected error from noopSink: %v", err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("unexpected error closing noopSink: %v", err)
+	}
+}
+
+func TestPrometheusSinkRecordUpgradeCheck(t *testing.T) {
+	sink := newPrometheusSink()
+
+	tags := map[string]string{
+		InfluxDBTagAppVersion:             "v1.0.0",
+		InfluxDBTagKubernetesVersion:      "v1.28.0",
+		InfluxDBTagLocationCountry:        "US",
+		InfluxDBTagLocationCity:           "Seattle",
+		InfluxDBTagLocationCountryISOCode: "US",
+	}
+	if err := sink.RecordUpgradeCheck(tags, nil, time.Now()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	count := testutil.ToFloat64(sink.counter.With(map[string]string{
+		"version":            "v1.0.0",
+		"kubernetes_version": "v1.28.0",
+		"country":            "US",
+		"city":               "Seattle",
+	}))
+	if count != 1 {
+		t.Fatalf("expected the counter to be incremented to 1, got %v", count)
+	}
+}